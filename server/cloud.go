@@ -4,31 +4,277 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
+var (
+	registerCloudHealthOnce sync.Once
+	leaderboardHealthy      atomic.Value // bool
+
+	// worldTickLastAt and terrainLastGeneratedAt back the "world_tick" and
+	// "terrain" health checks: each is updated from the subsystem's own
+	// hot path (RecordWorldTick, RecordTerrainGeneration) and is considered
+	// stale if it hasn't moved recently, independent of the cloud backend.
+	worldTickLastAt        atomic.Value // time.Time
+	terrainLastGeneratedAt atomic.Value // time.Time
+
+	// leaderboard replaces the old duplicate-name-clobbering playerScores
+	// map with windowed, identity-keyed standings. 50000 tracked identities
+	// comfortably covers a server's active population between restarts;
+	// a zero half-life leaves ranking undecayed.
+	leaderboard = NewLeaderboardAggregator(50000, 0)
+
+	// stats is the embedded KV store backing lifetime (cross-session)
+	// player stats, separate from the ephemeral in-memory scores above.
+	// Left nil when no store was opened (e.g. -stats-db wasn't set), in
+	// which case lifetime tracking and publishing are skipped.
+	stats StatsStore
+
+	// cloudSink holds the active LeaderboardSink (a cloudSinkHolder, so
+	// atomic.Value sees a consistent concrete type across Store calls).
+	// Cloud(), shutdown(), and watchSinkConfig's reload goroutine all
+	// reach it through loadCloudSink/storeCloudSink instead of a plain
+	// *Hub field, so a config reload can never race a push in flight.
+	cloudSink     atomic.Value // cloudSinkHolder
+	cloudSinkOnce sync.Once
+
+	// killDeathBaselines tracks each identity's last-observed Kills/Deaths
+	// totals, so Merge can be fed the per-tick increment instead of the
+	// player's running total (player.Kills/player.Deaths, like player.Score,
+	// are live cumulative counters, not deltas - adding the full total
+	// every tick would massively overcount).
+	killDeathBaselinesMu sync.Mutex
+	killDeathBaselines   = make(map[string]killDeathBaseline)
+)
+
+// killDeathBaseline is the last Kills/Deaths totals observed for an
+// identity, used by killDeathDelta to compute per-tick increments.
+type killDeathBaseline struct {
+	kills, deaths int
+	lastSeen      time.Time
+}
+
+// cloudTickInterval is how often Hub.Cloud() runs; used to approximate
+// playtime accrual per tick since there's no per-client session timer.
+const cloudTickInterval = 5 * time.Second
+
+// worldTickStaleAfter and terrainStaleAfter bound how long the "world_tick"
+// and "terrain" health checks tolerate silence before reporting unhealthy.
+const (
+	worldTickStaleAfter = 5 * time.Second
+	terrainStaleAfter   = time.Minute
+)
+
+// cloudSinkHolder wraps a LeaderboardSink so it can be stored in an
+// atomic.Value: the value stored there must always be the same concrete
+// type, which a bare interface value doesn't guarantee across calls.
+type cloudSinkHolder struct {
+	sink LeaderboardSink
+}
+
+// ensureCloudSink seeds cloudSink from h.cloud the first time it's called,
+// so callers that run before any config reload (shutdown, an early Cloud
+// tick) still have a sink to load.
+func ensureCloudSink(h *Hub) {
+	cloudSinkOnce.Do(func() {
+		cloudSink.Store(cloudSinkHolder{sink: h.cloud})
+	})
+}
+
+// storeCloudSink atomically replaces the active sink, e.g. after a config
+// reload in watchSinkConfig.
+func storeCloudSink(sink LeaderboardSink) {
+	cloudSink.Store(cloudSinkHolder{sink: sink})
+}
+
+// loadCloudSink returns the active sink. ensureCloudSink must have been
+// called at least once (directly or via Cloud()) before this is safe.
+func loadCloudSink() LeaderboardSink {
+	return cloudSink.Load().(cloudSinkHolder).sink
+}
+
+// RecordWorldTick is called once per world tick so the "world_tick" health
+// check and the tick-duration metric reflect real activity instead of
+// sitting permanently at zero.
+func RecordWorldTick(at time.Time, duration time.Duration) {
+	worldTickLastAt.Store(at)
+	metricTickDuration.Observe(duration.Seconds())
+}
+
+// RecordTerrainGeneration is called whenever the terrain generator produces
+// an update, backing the "terrain" health check and terrain-updates counter.
+func RecordTerrainGeneration(at time.Time) {
+	terrainLastGeneratedAt.Store(at)
+	metricTerrainUpdates.Inc()
+}
+
+// RecordSocketBytes is called from a socket's read/write path with the
+// number of bytes sent ("send") or received ("recv"), backing the
+// socket-throughput counter.
+func RecordSocketBytes(direction string, n int) {
+	metricSocketBytes.WithLabelValues(direction).Add(float64(n))
+}
+
+func registerCloudHealth(h *Hub) {
+	leaderboardHealthy.Store(true)
+
+	hubHealth.Register("cloud", func() healthStatus {
+		return healthStatus{OK: loadCloudSink() != nil}
+	})
+	hubHealth.Register("leaderboard", func() healthStatus {
+		if ok, _ := leaderboardHealthy.Load().(bool); !ok {
+			return healthStatus{OK: false, Message: "last leaderboard write failed"}
+		}
+		return healthStatus{OK: true}
+	})
+	hubHealth.Register("world_tick", func() healthStatus {
+		last, _ := worldTickLastAt.Load().(time.Time)
+		if last.IsZero() || time.Since(last) > worldTickStaleAfter {
+			return healthStatus{OK: false, Message: "no world tick recorded recently"}
+		}
+		return healthStatus{OK: true}
+	})
+	hubHealth.Register("terrain", func() healthStatus {
+		last, _ := terrainLastGeneratedAt.Load().(time.Time)
+		if last.IsZero() || time.Since(last) > terrainStaleAfter {
+			return healthStatus{OK: false, Message: "no terrain update recorded recently"}
+		}
+		return healthStatus{OK: true}
+	})
+}
+
+// killDeathDelta returns how many kills/deaths identity has accrued since
+// the last call, seeding a zero delta on the first observation so a
+// player's pre-existing totals aren't counted as a burst when they're
+// first seen.
+func killDeathDelta(identity string, kills, deaths int, now time.Time) (killDelta, deathDelta int) {
+	killDeathBaselinesMu.Lock()
+	defer killDeathBaselinesMu.Unlock()
+
+	prev, ok := killDeathBaselines[identity]
+	killDeathBaselines[identity] = killDeathBaseline{kills: kills, deaths: deaths, lastSeen: now}
+	if !ok {
+		return 0, 0
+	}
+	if kills > prev.kills {
+		killDelta = kills - prev.kills
+	}
+	if deaths > prev.deaths {
+		deathDelta = deaths - prev.deaths
+	}
+	return killDelta, deathDelta
+}
+
+// evictStaleKillDeathBaselines removes baselines not refreshed since maxAge
+// ago, mirroring LeaderboardAggregator.EvictStale so this side map doesn't
+// grow unbounded with identities that never return.
+func evictStaleKillDeathBaselines(now time.Time, maxAge time.Duration) {
+	killDeathBaselinesMu.Lock()
+	defer killDeathBaselinesMu.Unlock()
+
+	for identity, baseline := range killDeathBaselines {
+		if now.Sub(baseline.lastSeen) > maxAge {
+			delete(killDeathBaselines, identity)
+		}
+	}
+}
+
+// playerIdentity returns the stable identity used to key leaderboard and
+// lifetime-stats state: the player's session token / account ID, which
+// (unlike a client's heap address) survives reconnects and is never reused
+// by a different player.
+func playerIdentity(player *Player) string {
+	return player.SessionID
+}
+
 func (h *Hub) Cloud() {
+	ensureCloudSink(h)
+	registerCloudHealthOnce.Do(func() { registerCloudHealth(h) })
+
 	fmt.Println("Updating cloud")
 
 	playerCount := 0
+	botCount := 0
+	now := time.Now()
 
-	// Note: Cannot use to determine number of players, as long as there
-	// are duplicate names
-	playerScores := make(map[string]int)
+	metricPlayersByTeam.Reset()
 
 	for client := h.clients.First; client != nil; client = client.Data().Next {
+		if _, ok := client.(*BotClient); ok {
+			botCount++
+			continue
+		}
 		if _, ok := client.(*SocketClient); ok {
 			playerCount++
 			player := &client.Data().Player
 			if player.Score > 0 {
-				playerScores[player.Name] = player.Score
+				identity := playerIdentity(player)
+				leaderboard.Observe(identity, player.Name, player.Score, now)
+
+				if stats != nil {
+					killDelta, deathDelta := killDeathDelta(identity, player.Kills, player.Deaths, now)
+					if err := stats.Merge(identity, PlayerStatsDelta{
+						Name:         player.Name,
+						Kills:        killDelta,
+						Deaths:       deathDelta,
+						Score:        player.Score,
+						PlaytimeSecs: int(cloudTickInterval.Seconds()),
+						ShipType:     player.ShipType,
+					}); err != nil {
+						fmt.Println("stats merge error:", err)
+					}
+				}
 			}
+			metricPlayersByTeam.WithLabelValues(player.TeamName()).Inc()
 		}
 	}
 
+	leaderboard.EvictStale(now, 7*24*time.Hour)
+	evictStaleKillDeathBaselines(now, 7*24*time.Hour)
+	metricBots.Set(float64(botCount))
+
+	sink := loadCloudSink()
+
 	go func() {
-		err := h.cloud.UpdateLeaderboard(playerScores)
+		start := time.Now()
+
+		var err error
+		for _, window := range []Window{WindowHour, WindowDay, WindowWeek, WindowAllTime} {
+			scores := make(map[string]int)
+			for _, entry := range leaderboard.Snapshot(window, 100, now) {
+				scores[entry.Name] = entry.Score
+			}
+			if updateErr := sink.UpdateLeaderboard(window, scores); updateErr != nil {
+				err = updateErr
+			}
+		}
+
+		if stats != nil {
+			if entries, topErr := stats.TopN("highest_score", 100); topErr != nil {
+				fmt.Println("lifetime leaderboard error:", topErr)
+			} else {
+				lifetimeScores := make(map[string]int, len(entries))
+				for _, entry := range entries {
+					lifetimeScores[entry.Stats.Name] = entry.Stats.HighestScore
+				}
+				// Pushed under WindowLifetime, distinct from WindowAllTime,
+				// so sinks don't merge "current-session best" (the in-memory
+				// aggregator, above) with "lifetime highest" (the persistent
+				// store) into one last-write-wins board.
+				if updateErr := sink.UpdateLeaderboard(WindowLifetime, lifetimeScores); updateErr != nil {
+					err = updateErr
+				}
+			}
+		}
+
+		metricLeaderboardUpdateDuration.Observe(time.Since(start).Seconds())
+		leaderboardHealthy.Store(err == nil)
 		if err != nil {
+			metricLeaderboardUpdateErrors.Inc()
 			fmt.Println("leaderboard error:", err)
 		}
 	}()
@@ -45,5 +291,5 @@ func (h *Hub) Cloud() {
 		fmt.Println("error marshaling status:", err)
 	}
 
-	_ = h.cloud.UpdateServer(playerCount)
-}
\ No newline at end of file
+	_ = sink.UpdateServer(playerCount)
+}
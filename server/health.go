@@ -0,0 +1,87 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	ejson "encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// healthStatus is the state of a single subsystem, as reported by a
+// healthCheck.
+type healthStatus struct {
+	OK      bool   `json:"ok"`
+	Message string `json:"message,omitempty"`
+}
+
+// healthCheck is implemented by any subsystem that wants to participate
+// in the aggregate /health response.
+type healthCheck func() healthStatus
+
+// healthAggregator collects healthChecks registered by name and reports
+// their combined status. It is safe for concurrent use.
+type healthAggregator struct {
+	mu     sync.Mutex
+	checks map[string]healthCheck
+}
+
+func newHealthAggregator() *healthAggregator {
+	return &healthAggregator{checks: make(map[string]healthCheck)}
+}
+
+// hubHealth is the process-wide aggregator. Subsystems (cloud, leaderboard,
+// world tick, terrain) register their check with it; startObservabilityServer
+// exposes it over /health alongside /metrics.
+var hubHealth = newHealthAggregator()
+
+// Register adds or replaces the healthCheck for the named subsystem.
+func (a *healthAggregator) Register(name string, check healthCheck) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.checks[name] = check
+}
+
+// report runs every registered healthCheck and returns the per-component
+// statuses along with the overall pass/fail.
+func (a *healthAggregator) report() (ok bool, components map[string]healthStatus) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	ok = true
+	components = make(map[string]healthStatus, len(a.checks))
+	for name, check := range a.checks {
+		status := check()
+		components[name] = status
+		if !status.OK {
+			ok = false
+		}
+	}
+	return
+}
+
+// serveHealth registers the /health endpoint on mux, returning a JSON body
+// describing the overall and per-subsystem health of the hub. Responds with
+// 503 when any subsystem reports unhealthy.
+func (a *healthAggregator) serveHealth(mux *http.ServeMux) {
+	mux.HandleFunc("/health", func(w http.ResponseWriter, _ *http.Request) {
+		ok, components := a.report()
+
+		w.Header().Set("Content-Type", "application/json")
+		if !ok {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+
+		_ = ejson.NewEncoder(w).Encode(struct {
+			OK         bool                    `json:"ok"`
+			Components map[string]healthStatus `json:"components"`
+			Time       time.Time               `json:"time"`
+		}{
+			OK:         ok,
+			Components: components,
+			Time:       time.Now(),
+		})
+	})
+}
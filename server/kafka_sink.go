@@ -0,0 +1,89 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	ejson "encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// kafkaSink emits a per-player score event for every entry in a
+// leaderboard update, and a match-summary event for every server status
+// update, onto configurable topics.
+type kafkaSink struct {
+	producer     sarama.SyncProducer
+	scoreTopic   string
+	summaryTopic string
+}
+
+// playerScoreEvent is emitted once per player on scoreTopic.
+type playerScoreEvent struct {
+	Player string `json:"player"`
+	Window string `json:"window"`
+	Score  int    `json:"score"`
+	Time   int64  `json:"time"`
+}
+
+// matchSummaryEvent is emitted once per UpdateServer call on summaryTopic.
+type matchSummaryEvent struct {
+	Players int   `json:"players"`
+	Time    int64 `json:"time"`
+}
+
+// newKafkaSink dials brokers synchronously and returns a sink that emits
+// to scoreTopic and summaryTopic.
+func newKafkaSink(brokers []string, scoreTopic, summaryTopic string) (*kafkaSink, error) {
+	config := sarama.NewConfig()
+	config.Producer.Return.Successes = true
+	config.Producer.RequiredAcks = sarama.WaitForLocal
+	config.Producer.Timeout = 5 * time.Second
+
+	producer, err := sarama.NewSyncProducer(brokers, config)
+	if err != nil {
+		return nil, fmt.Errorf("kafka sink: dial: %w", err)
+	}
+
+	return &kafkaSink{producer: producer, scoreTopic: scoreTopic, summaryTopic: summaryTopic}, nil
+}
+
+func (s *kafkaSink) UpdateLeaderboard(window Window, scores map[string]int) error {
+	now := time.Now().Unix()
+	for name, score := range scores {
+		event, err := ejson.Marshal(playerScoreEvent{Player: name, Window: window.String(), Score: score, Time: now})
+		if err != nil {
+			return fmt.Errorf("kafka sink: marshal score event: %w", err)
+		}
+		if _, _, err := s.producer.SendMessage(&sarama.ProducerMessage{
+			Topic: s.scoreTopic,
+			Key:   sarama.StringEncoder(name),
+			Value: sarama.ByteEncoder(event),
+		}); err != nil {
+			return fmt.Errorf("kafka sink: send score event: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *kafkaSink) UpdateServer(players int) error {
+	event, err := ejson.Marshal(matchSummaryEvent{Players: players, Time: time.Now().Unix()})
+	if err != nil {
+		return fmt.Errorf("kafka sink: marshal summary event: %w", err)
+	}
+	_, _, err = s.producer.SendMessage(&sarama.ProducerMessage{
+		Topic: s.summaryTopic,
+		Value: sarama.ByteEncoder(event),
+	})
+	if err != nil {
+		return fmt.Errorf("kafka sink: send summary event: %w", err)
+	}
+	return nil
+}
+
+// Close releases the underlying Kafka producer.
+func (s *kafkaSink) Close() error {
+	return s.producer.Close()
+}
@@ -0,0 +1,382 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"container/heap"
+	"math"
+	"sync"
+	"time"
+)
+
+// Window is one of the rolling periods LeaderboardAggregator maintains
+// standings for.
+type Window int
+
+const (
+	WindowHour Window = iota
+	WindowDay
+	WindowWeek
+	WindowAllTime
+	// WindowLifetime labels the persisted StatsStore's highest-score
+	// ranking when pushed through a LeaderboardSink. It's never passed to
+	// LeaderboardAggregator itself (that ranking comes from TopN, not
+	// Snapshot) - it exists so sinks can tell "lifetime" apart from the
+	// in-memory WindowAllTime instead of the two colliding on one key.
+	WindowLifetime
+)
+
+// String returns w's external name, used by sinks that need to label a
+// push (e.g. the Kafka score event) with which window it belongs to.
+func (w Window) String() string {
+	switch w {
+	case WindowHour:
+		return "hour"
+	case WindowDay:
+		return "day"
+	case WindowWeek:
+		return "week"
+	case WindowAllTime:
+		return "all_time"
+	default:
+		return "lifetime"
+	}
+}
+
+// duration returns the lookback for w, or 0 for WindowAllTime (no bound).
+func (w Window) duration() time.Duration {
+	switch w {
+	case WindowHour:
+		return time.Hour
+	case WindowDay:
+		return 24 * time.Hour
+	case WindowWeek:
+		return 7 * 24 * time.Hour
+	default:
+		return 0
+	}
+}
+
+// ringBuckets covers WindowWeek, the largest bounded window, at one
+// minute resolution.
+const ringBuckets = 7 * 24 * 60
+
+// LeaderboardEntry is one ranked row of a Snapshot.
+type LeaderboardEntry struct {
+	PlayerID   string
+	Name       string
+	Score      int
+	AchievedAt time.Time
+}
+
+// scoreBucket accumulates the score a player earned during one minute.
+// epochMinute is the bucket's minute index (unix seconds / 60); a bucket
+// whose epochMinute doesn't match the slot's expected minute is stale and
+// treated as empty, which is how the ring buffer reuses slots without
+// zeroing them all on rollover.
+type scoreBucket struct {
+	epochMinute int64
+	score       int
+}
+
+// trackedPlayer is the per-identity state backing every window. Each
+// bucket holds the highest score observed for that player during that
+// minute (player.Score is a live snapshot of their current run, not a
+// per-tick delta, so buckets track a high-water mark rather than a sum).
+type trackedPlayer struct {
+	identity    string
+	name        string
+	buckets     [ringBuckets]scoreBucket
+	allTimeBest int
+	allTimeAt   time.Time
+	firstSeen   time.Time
+	lastSeen    time.Time
+}
+
+func epochMinute(t time.Time) int64 {
+	return t.Unix() / 60
+}
+
+// observe records that the player's score was 'score' at 'at', raising
+// the high-water mark for that minute's bucket and for all-time.
+func (p *trackedPlayer) observe(score int, at time.Time) {
+	minute := epochMinute(at)
+	slot := &p.buckets[minute%ringBuckets]
+	if slot.epochMinute != minute {
+		*slot = scoreBucket{epochMinute: minute, score: 0}
+	}
+	if score > slot.score {
+		slot.score = score
+	}
+
+	if score > p.allTimeBest {
+		p.allTimeBest = score
+		p.allTimeAt = at
+	}
+	if p.firstSeen.IsZero() {
+		p.firstSeen = at
+	}
+	p.lastSeen = at
+}
+
+// windowScore returns the highest score observed within window as of now,
+// along with the earliest timestamp that score was reached (used to
+// tie-break equal scores by who got there first).
+func (p *trackedPlayer) windowScore(window Window, now time.Time) (best int, earliest time.Time) {
+	if window == WindowAllTime {
+		return p.allTimeBest, p.allTimeAt
+	}
+
+	cutoff := now.Add(-window.duration())
+	cutoffMinute := epochMinute(cutoff)
+	nowMinute := epochMinute(now)
+
+	span := nowMinute - cutoffMinute
+	if span > ringBuckets {
+		span = ringBuckets
+	}
+
+	for i := int64(0); i <= span; i++ {
+		minute := nowMinute - i
+		if minute < cutoffMinute {
+			break
+		}
+		bucket := &p.buckets[((minute%ringBuckets)+ringBuckets)%ringBuckets]
+		if bucket.epochMinute != minute || bucket.score == 0 {
+			continue
+		}
+		bucketTime := time.Unix(minute*60, 0)
+		switch {
+		case bucket.score > best:
+			best, earliest = bucket.score, bucketTime
+		case bucket.score == best && bucketTime.Before(earliest):
+			earliest = bucketTime
+		}
+	}
+	return best, earliest
+}
+
+// decayedScore applies exponential decay to sum based on its age, with
+// halfLife controlling how quickly older scores fade. A zero halfLife
+// disables decay.
+func decayedScore(sum int, earliest, now time.Time, halfLife time.Duration) float64 {
+	if halfLife <= 0 || earliest.IsZero() {
+		return float64(sum)
+	}
+	age := now.Sub(earliest)
+	if age <= 0 {
+		return float64(sum)
+	}
+	return float64(sum) * math.Pow(0.5, age.Seconds()/halfLife.Seconds())
+}
+
+// LeaderboardAggregator replaces the old playerScores map with per-window
+// top-N standings keyed by a stable player identity (session token or
+// account ID) rather than display name, so duplicate names no longer
+// clobber each other. It bounds memory to maxTracked identities, evicting
+// the lowest-scoring entry once that cap is hit.
+type LeaderboardAggregator struct {
+	mu         sync.Mutex
+	players    map[string]*trackedPlayer
+	maxTracked int
+	halfLife   time.Duration // 0 disables decay
+}
+
+// NewLeaderboardAggregator returns an aggregator bounded to maxTracked
+// identities. halfLife, if nonzero, applies exponential decay when
+// ranking (older scores count for less); it does not affect the raw
+// scores returned in LeaderboardEntry.Score.
+func NewLeaderboardAggregator(maxTracked int, halfLife time.Duration) *LeaderboardAggregator {
+	return &LeaderboardAggregator{
+		players:    make(map[string]*trackedPlayer),
+		maxTracked: maxTracked,
+		halfLife:   halfLife,
+	}
+}
+
+// Observe records that identity, currently displayed as name, had score
+// at 'at'.
+func (a *LeaderboardAggregator) Observe(identity, name string, score int, at time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	player, ok := a.players[identity]
+	if !ok {
+		if len(a.players) >= a.maxTracked {
+			a.evictLowestLocked()
+		}
+		player = &trackedPlayer{identity: identity}
+		a.players[identity] = player
+	}
+	player.name = name
+	player.observe(score, at)
+}
+
+// evictLowestLocked removes the tracked player with the lowest all-time
+// best score. Callers must hold a.mu.
+func (a *LeaderboardAggregator) evictLowestLocked() {
+	var worst *trackedPlayer
+	for _, p := range a.players {
+		if worst == nil || p.allTimeBest < worst.allTimeBest {
+			worst = p
+		}
+	}
+	if worst != nil {
+		delete(a.players, worst.identity)
+	}
+}
+
+// EvictStale removes players whose last score is older than maxAge,
+// bounding memory for identities that never return.
+func (a *LeaderboardAggregator) EvictStale(now time.Time, maxAge time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for identity, p := range a.players {
+		if now.Sub(p.lastSeen) > maxAge {
+			delete(a.players, identity)
+		}
+	}
+}
+
+// rankedEntry is a LeaderboardEntry plus its decayed ranking score, used
+// internally to drive the top-N heap.
+type rankedEntry struct {
+	LeaderboardEntry
+	rank float64
+}
+
+// entryHeap is a min-heap on rank, so pushing past n lets us drop the
+// worst entry and keep only the top n overall.
+type entryHeap []rankedEntry
+
+func (h entryHeap) Len() int { return len(h) }
+func (h entryHeap) Less(i, j int) bool {
+	if h[i].rank != h[j].rank {
+		return h[i].rank < h[j].rank
+	}
+	// Tie: the entry achieved earlier should be treated as "greater" (it
+	// outranks the later one), so it's the later timestamp that's smaller
+	// in heap terms and gets popped first when trimming.
+	return h[i].AchievedAt.After(h[j].AchievedAt)
+}
+func (h entryHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *entryHeap) Push(x interface{}) {
+	*h = append(*h, x.(rankedEntry))
+}
+func (h *entryHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
+
+// playerRecord is the serializable form of trackedPlayer, used to persist
+// and restore the aggregator's state across restarts.
+type playerRecord struct {
+	Identity    string         `json:"identity"`
+	Name        string         `json:"name"`
+	AllTimeBest int            `json:"all_time_best"`
+	AllTimeAt   time.Time      `json:"all_time_at"`
+	FirstSeen   time.Time      `json:"first_seen"`
+	LastSeen    time.Time      `json:"last_seen"`
+	Buckets     []bucketRecord `json:"buckets,omitempty"`
+}
+
+// bucketRecord is the serializable form of a non-empty scoreBucket.
+type bucketRecord struct {
+	EpochMinute int64 `json:"epoch_minute"`
+	Score       int   `json:"score"`
+}
+
+// MarshalRecords returns every tracked player as a playerRecord, suitable
+// for persisting to a snapshot.
+func (a *LeaderboardAggregator) MarshalRecords() []playerRecord {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	records := make([]playerRecord, 0, len(a.players))
+	for _, p := range a.players {
+		record := playerRecord{
+			Identity:    p.identity,
+			Name:        p.name,
+			AllTimeBest: p.allTimeBest,
+			AllTimeAt:   p.allTimeAt,
+			FirstSeen:   p.firstSeen,
+			LastSeen:    p.lastSeen,
+		}
+		for _, bucket := range p.buckets {
+			if bucket.epochMinute != 0 {
+				record.Buckets = append(record.Buckets, bucketRecord{EpochMinute: bucket.epochMinute, Score: bucket.score})
+			}
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// LoadRecords replaces the aggregator's state with records, as read back
+// from a snapshot. It is meant to be called once, before the aggregator
+// starts receiving live Observe calls.
+func (a *LeaderboardAggregator) LoadRecords(records []playerRecord) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.players = make(map[string]*trackedPlayer, len(records))
+	for _, record := range records {
+		player := &trackedPlayer{
+			identity:    record.Identity,
+			name:        record.Name,
+			allTimeBest: record.AllTimeBest,
+			allTimeAt:   record.AllTimeAt,
+			firstSeen:   record.FirstSeen,
+			lastSeen:    record.LastSeen,
+		}
+		for _, bucket := range record.Buckets {
+			player.buckets[((bucket.EpochMinute%ringBuckets)+ringBuckets)%ringBuckets] = scoreBucket{
+				epochMinute: bucket.EpochMinute,
+				score:       bucket.Score,
+			}
+		}
+		a.players[record.Identity] = player
+	}
+}
+
+// Snapshot returns the top n ranked entries for window as of now, highest
+// score first, ties broken by whoever reached that score earliest.
+func (a *LeaderboardAggregator) Snapshot(window Window, n int, now time.Time) []LeaderboardEntry {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	h := &entryHeap{}
+	heap.Init(h)
+
+	for _, p := range a.players {
+		sum, earliest := p.windowScore(window, now)
+		if sum <= 0 {
+			continue
+		}
+		entry := rankedEntry{
+			LeaderboardEntry: LeaderboardEntry{
+				PlayerID:   p.identity,
+				Name:       p.name,
+				Score:      sum,
+				AchievedAt: earliest,
+			},
+			rank: decayedScore(sum, earliest, now, a.halfLife),
+		}
+
+		heap.Push(h, entry)
+		if h.Len() > n {
+			heap.Pop(h)
+		}
+	}
+
+	entries := make([]LeaderboardEntry, h.Len())
+	for i := len(entries) - 1; i >= 0; i-- {
+		entries[i] = heap.Pop(h).(rankedEntry).LeaderboardEntry
+	}
+	return entries
+}
@@ -0,0 +1,141 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"gopkg.in/yaml.v3"
+)
+
+// sinkConfig describes which LeaderboardSink backends are enabled and how
+// to reach them. It is loaded from YAML, with secrets overridable by
+// environment variables so they need not be checked into the config file.
+type sinkConfig struct {
+	FanOutTimeout time.Duration `yaml:"fan_out_timeout"`
+
+	HTTP struct {
+		Enabled bool `yaml:"enabled"`
+	} `yaml:"http"`
+
+	Redis struct {
+		Enabled   bool   `yaml:"enabled"`
+		Addr      string `yaml:"addr"`
+		Password  string `yaml:"password"` // overridable by MK48_REDIS_PASSWORD
+		DB        int    `yaml:"db"`
+		KeyPrefix string `yaml:"key_prefix"`
+	} `yaml:"redis"`
+
+	Kafka struct {
+		Enabled      bool     `yaml:"enabled"`
+		Brokers      []string `yaml:"brokers"` // overridable by MK48_KAFKA_BROKERS (comma-separated)
+		ScoreTopic   string   `yaml:"score_topic"`
+		SummaryTopic string   `yaml:"summary_topic"`
+	} `yaml:"kafka"`
+}
+
+// loadSinkConfig reads and parses the sink config at path, applying
+// environment overrides for secrets and broker lists.
+func loadSinkConfig(path string) (*sinkConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("load sink config: %w", err)
+	}
+
+	cfg := &sinkConfig{FanOutTimeout: 2 * time.Second}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("parse sink config: %w", err)
+	}
+
+	if password := os.Getenv("MK48_REDIS_PASSWORD"); password != "" {
+		cfg.Redis.Password = password
+	}
+	if brokers := os.Getenv("MK48_KAFKA_BROKERS"); brokers != "" {
+		cfg.Kafka.Brokers = strings.Split(brokers, ",")
+	}
+
+	return cfg, nil
+}
+
+// buildSink constructs the LeaderboardSink described by cfg, reusing
+// httpSink (the existing cloud client) when HTTP is enabled and fanning
+// out to every other enabled backend.
+func buildSink(cfg *sinkConfig, httpSink LeaderboardSink) (LeaderboardSink, error) {
+	var sinks []LeaderboardSink
+
+	if cfg.HTTP.Enabled && httpSink != nil {
+		sinks = append(sinks, httpSink)
+	}
+	if cfg.Redis.Enabled {
+		sinks = append(sinks, newRedisSink(cfg.Redis.Addr, cfg.Redis.Password, cfg.Redis.DB, cfg.Redis.KeyPrefix, cfg.FanOutTimeout))
+	}
+	if cfg.Kafka.Enabled {
+		sink, err := newKafkaSink(cfg.Kafka.Brokers, cfg.Kafka.ScoreTopic, cfg.Kafka.SummaryTopic)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+
+	if len(sinks) == 0 {
+		return nil, fmt.Errorf("build sink: no backends enabled")
+	}
+	if len(sinks) == 1 {
+		return sinks[0], nil
+	}
+	return newFanOutSink(cfg.FanOutTimeout, sinks...), nil
+}
+
+// watchSinkConfig reloads the sink config whenever path changes on disk,
+// swapping the active sink through storeCloudSink (server/cloud.go),
+// which holds it behind an atomic.Value so in-flight Cloud() calls never
+// race the reload. httpSink is kept constant across reloads since it has
+// no config of its own today.
+func watchSinkConfig(h *Hub, path string, httpSink LeaderboardSink) error {
+	ensureCloudSink(h)
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("watch sink config: %w", err)
+	}
+	if err := watcher.Add(path); err != nil {
+		watcher.Close()
+		return fmt.Errorf("watch sink config: %w", err)
+	}
+
+	go func() {
+		defer watcher.Close()
+		for event := range watcher.Events {
+			if event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+				continue
+			}
+			cfg, err := loadSinkConfig(path)
+			if err != nil {
+				fmt.Println("sink config reload error:", err)
+				continue
+			}
+			sink, err := buildSink(cfg, httpSink)
+			if err != nil {
+				fmt.Println("sink config reload error:", err)
+				continue
+			}
+			previous := loadCloudSink()
+			storeCloudSink(sink)
+			fmt.Println("reloaded leaderboard sink config from", path)
+
+			// Close the sink the reload just replaced, not httpSink (kept
+			// constant across reloads and still referenced by the new
+			// sink), or every reload leaks a Kafka producer/Redis client.
+			if err := closeSink(previous); err != nil {
+				fmt.Println("sink config reload: error closing previous sink:", err)
+			}
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,125 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// LeaderboardSink is anything that can receive leaderboard and server
+// status updates from Hub.Cloud(). The existing HTTP cloud client already
+// satisfies this interface; redisSink and kafkaSink are additional
+// implementations, and fanOutSink composes several of them. window
+// identifies which of Hub.Cloud()'s independent snapshots (1h/24h/7d/
+// all-time) scores belongs to, so a sink can tell them apart instead of
+// receiving four indistinguishable last-write-wins pushes per tick.
+type LeaderboardSink interface {
+	UpdateLeaderboard(window Window, scores map[string]int) error
+	UpdateServer(players int) error
+}
+
+// fanOutSink dispatches every update to all of its sinks concurrently, so
+// that a slow or unreachable backend (e.g. Kafka) cannot stall the hub
+// tick. Each sink gets its own timeout; errors are collected but isolated
+// per sink.
+type fanOutSink struct {
+	sinks   []LeaderboardSink
+	timeout time.Duration
+}
+
+// newFanOutSink returns a LeaderboardSink that fans out to sinks, giving
+// each one timeout to complete before its update is counted as failed.
+func newFanOutSink(timeout time.Duration, sinks ...LeaderboardSink) *fanOutSink {
+	return &fanOutSink{sinks: sinks, timeout: timeout}
+}
+
+func (f *fanOutSink) UpdateLeaderboard(window Window, scores map[string]int) error {
+	return f.dispatch(func(sink LeaderboardSink) error {
+		return sink.UpdateLeaderboard(window, scores)
+	})
+}
+
+func (f *fanOutSink) UpdateServer(players int) error {
+	return f.dispatch(func(sink LeaderboardSink) error {
+		return sink.UpdateServer(players)
+	})
+}
+
+// dispatch runs call against every sink concurrently, bounding each by
+// f.timeout, and returns a combined error describing which sinks failed
+// (nil if all succeeded).
+func (f *fanOutSink) dispatch(call func(LeaderboardSink) error) error {
+	type result struct {
+		index int
+		err   error
+	}
+
+	results := make(chan result, len(f.sinks))
+	for i, sink := range f.sinks {
+		go func(i int, sink LeaderboardSink) {
+			done := make(chan error, 1)
+			go func() { done <- call(sink) }()
+
+			select {
+			case err := <-done:
+				results <- result{i, err}
+			case <-time.After(f.timeout):
+				results <- result{i, fmt.Errorf("sink %d: timed out after %s", i, f.timeout)}
+			}
+		}(i, sink)
+	}
+
+	var errs []error
+	for range f.sinks {
+		if r := <-results; r.err != nil {
+			errs = append(errs, r.err)
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("fan-out sink: %d/%d sinks failed: %w", len(errs), len(f.sinks), joinErrors(errs))
+}
+
+// joinErrors folds errs into a single error, preserving each message.
+func joinErrors(errs []error) error {
+	msg := errs[0].Error()
+	for _, err := range errs[1:] {
+		msg += "; " + err.Error()
+	}
+	return fmt.Errorf("%s", msg)
+}
+
+// ctxTimeout is a small helper used by the redis sink for bounding its
+// network calls.
+func ctxTimeout(timeout time.Duration) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+// closeSink releases any resource sink holds open (a Kafka producer, a
+// Redis client), recursing into a fanOutSink's members. Sinks that don't
+// hold anything open - the existing HTTP cloud client - simply don't
+// implement Close and are left alone. Used by watchSinkConfig to clean up
+// the sink a reload just replaced.
+func closeSink(sink LeaderboardSink) error {
+	if fanOut, ok := sink.(*fanOutSink); ok {
+		var errs []error
+		for _, s := range fanOut.sinks {
+			if err := closeSink(s); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if len(errs) == 0 {
+			return nil
+		}
+		return fmt.Errorf("close fan-out sink: %w", joinErrors(errs))
+	}
+	if closer, ok := sink.(interface{ Close() error }); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics are the Prometheus collectors updated throughout the hub's
+// lifecycle. They are package-level so any subsystem (world, terrain,
+// socket I/O) can record against them without needing a reference to the
+// Hub. Every collector here is observed from a real call site
+// (RecordWorldTick, RecordTerrainGeneration, RecordSocketBytes, all in
+// server/cloud.go) — don't add one without also wiring it, or /metrics
+// silently reports a permanent zero.
+var (
+	metricPlayersByTeam = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "mk48_players",
+		Help: "Number of connected players, by team.",
+	}, []string{"team"})
+
+	metricBots = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "mk48_bots",
+		Help: "Number of bot-controlled players currently active.",
+	})
+
+	metricTickDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "mk48_tick_duration_seconds",
+		Help:    "Duration of a single world tick.",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	metricTerrainUpdates = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "mk48_terrain_updates_total",
+		Help: "Number of terrain updates generated.",
+	})
+
+	metricSocketBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "mk48_socket_bytes_total",
+		Help: "Bytes sent/received over player sockets.",
+	}, []string{"direction"})
+
+	metricLeaderboardUpdateDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "mk48_leaderboard_update_duration_seconds",
+		Help:    "Duration of leaderboard updates pushed to the cloud backend.",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	metricLeaderboardUpdateErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "mk48_leaderboard_update_errors_total",
+		Help: "Number of leaderboard updates that returned an error.",
+	})
+)
+
+// serveMetrics registers the /metrics endpoint on mux, exposing all
+// collectors registered above in the Prometheus text format.
+func serveMetrics(mux *http.ServeMux) {
+	mux.Handle("/metrics", promhttp.Handler())
+}
+
+// startObservabilityServer serves /metrics and /health on addr, letting
+// operators point monitoring and load-balancer health checks at a single
+// port instead of parsing stdout or the legacy statusJSON blob.
+func startObservabilityServer(addr string) *http.Server {
+	mux := http.NewServeMux()
+	serveMetrics(mux)
+	hubHealth.serveHealth(mux)
+
+	server := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			fmt.Println("observability server error:", err)
+		}
+	}()
+	return server
+}
@@ -0,0 +1,94 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// redisPeriod describes the sorted-set suffix and TTL redisSink uses for
+// one Window. redisSink only maintains daily/weekly/all-time/lifetime
+// boards; WindowHour has no Redis period and is silently skipped.
+type redisPeriod struct {
+	suffix string
+	ttl    time.Duration
+}
+
+var redisPeriodByWindow = map[Window]redisPeriod{
+	WindowDay:      {suffix: "daily", ttl: 25 * time.Hour},
+	WindowWeek:     {suffix: "weekly", ttl: 8 * 24 * time.Hour},
+	WindowAllTime:  {suffix: "alltime", ttl: 0},  // no expiry
+	WindowLifetime: {suffix: "lifetime", ttl: 0}, // no expiry
+}
+
+// redisSink publishes leaderboard scores to Redis sorted sets, one per
+// rolling window, keyed by the period suffix so operators can read
+// "leaderboard:daily", "leaderboard:weekly", etc. directly.
+type redisSink struct {
+	client    *redis.Client
+	keyPrefix string
+	timeout   time.Duration
+}
+
+// newRedisSink connects to the Redis instance described by addr and
+// returns a sink that writes under keyPrefix (e.g. "leaderboard").
+func newRedisSink(addr, password string, db int, keyPrefix string, timeout time.Duration) *redisSink {
+	return &redisSink{
+		client: redis.NewClient(&redis.Options{
+			Addr:     addr,
+			Password: password,
+			DB:       db,
+		}),
+		keyPrefix: keyPrefix,
+		timeout:   timeout,
+	}
+}
+
+func (s *redisSink) UpdateLeaderboard(window Window, scores map[string]int) error {
+	if len(scores) == 0 {
+		return nil
+	}
+
+	period, ok := redisPeriodByWindow[window]
+	if !ok {
+		// redisSink doesn't maintain a board for this window (e.g. hourly).
+		return nil
+	}
+
+	ctx, cancel := ctxTimeout(s.timeout)
+	defer cancel()
+
+	key := fmt.Sprintf("%s:%s", s.keyPrefix, period.suffix)
+
+	members := make([]*redis.Z, 0, len(scores))
+	for name, score := range scores {
+		members = append(members, &redis.Z{Score: float64(score), Member: name})
+	}
+
+	if err := s.client.ZAdd(ctx, key, members...).Err(); err != nil {
+		return fmt.Errorf("redis sink: zadd %s: %w", key, err)
+	}
+	if period.ttl > 0 {
+		if err := s.client.Expire(ctx, key, period.ttl).Err(); err != nil {
+			return fmt.Errorf("redis sink: expire %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+func (s *redisSink) UpdateServer(players int) error {
+	ctx, cancel := ctxTimeout(s.timeout)
+	defer cancel()
+
+	key := fmt.Sprintf("%s:players", s.keyPrefix)
+	return s.client.Set(ctx, key, players, time.Minute).Err()
+}
+
+// Close releases the underlying Redis client connection.
+func (s *redisSink) Close() error {
+	return s.client.Close()
+}
@@ -0,0 +1,155 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// acceptingConnections gates whether the socket listener should accept
+// new clients; Shutdown flips it false before doing anything else.
+var acceptingConnections atomic.Bool
+
+func init() {
+	acceptingConnections.Store(true)
+}
+
+// AcceptingConnections reports whether new sockets should still be
+// accepted. The listener's accept loop should check this and refuse new
+// connections once it goes false.
+func AcceptingConnections() bool {
+	return acceptingConnections.Load()
+}
+
+// snapshotDir is where Shutdown writes its snapshot and where the hub
+// looks for one to restore on boot. It mirrors the "sync on boot" pattern
+// used by server-management daemons that must not lose state across a
+// rolling deploy.
+var snapshotDir = "snapshots"
+
+// Shutdown stops accepting new sockets, flushes a final synchronous Cloud
+// update, serializes live world state to a snapshot, and returns once
+// that's done or ctx's deadline passes, whichever is first.
+func (h *Hub) Shutdown(ctx context.Context) error {
+	acceptingConnections.Store(false)
+
+	done := make(chan error, 1)
+	go func() { done <- h.shutdown() }()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("shutdown: %w before snapshot finished", ctx.Err())
+	}
+}
+
+// shutdown does the actual flush-and-serialize work; it is run in its own
+// goroutine so Shutdown can still honor ctx's deadline.
+func (h *Hub) shutdown() error {
+	// Run synchronously (unlike the ticking Cloud(), whose leaderboard push
+	// is fire-and-forget) so the final standings aren't lost if the
+	// process exits before that goroutine gets scheduled.
+	ensureCloudSink(h)
+	if err := loadCloudSink().UpdateLeaderboard(WindowAllTime, h.finalLeaderboardScores()); err != nil {
+		fmt.Println("shutdown: final leaderboard flush failed:", err)
+	}
+
+	payload := snapshotPayload{
+		SavedAt:     time.Now(),
+		Leaderboard: leaderboard.MarshalRecords(),
+	}
+
+	if world, err := h.world.Serialize(); err != nil {
+		fmt.Println("shutdown: serialize world failed:", err)
+	} else {
+		payload.World = world
+	}
+
+	if terrain, err := h.terrain.Serialize(); err != nil {
+		fmt.Println("shutdown: serialize terrain failed:", err)
+	} else {
+		payload.Terrain = terrain
+	}
+
+	path, err := writeSnapshot(snapshotDir, payload)
+	if err != nil {
+		return fmt.Errorf("shutdown: %w", err)
+	}
+	fmt.Println("shutdown: wrote snapshot to", path)
+
+	if stats != nil {
+		if err := stats.Close(); err != nil {
+			fmt.Println("shutdown: close stats store failed:", err)
+		}
+	}
+
+	return nil
+}
+
+// finalLeaderboardScores returns the all-time standings as a plain
+// name->score map, the shape the existing cloud client expects.
+func (h *Hub) finalLeaderboardScores() map[string]int {
+	scores := make(map[string]int)
+	for _, entry := range leaderboard.Snapshot(WindowAllTime, 100, time.Now()) {
+		scores[entry.Name] = entry.Score
+	}
+	return scores
+}
+
+// Restore loads the most recent snapshot in snapshotDir, if any, and
+// rehydrates the leaderboard, world, and terrain from it so a rolling
+// deploy doesn't reset standings or regenerate the map mid-round.
+func (h *Hub) Restore() error {
+	payload, err := LoadLatestSnapshot(snapshotDir)
+	if err != nil {
+		return fmt.Errorf("restore: %w", err)
+	}
+	if payload == nil {
+		return nil
+	}
+
+	leaderboard.LoadRecords(payload.Leaderboard)
+
+	if payload.World != nil {
+		if err := h.world.Deserialize(payload.World); err != nil {
+			fmt.Println("restore: deserialize world failed:", err)
+		}
+	}
+	if payload.Terrain != nil {
+		if err := h.terrain.Deserialize(payload.Terrain); err != nil {
+			fmt.Println("restore: deserialize terrain failed:", err)
+		}
+	}
+
+	fmt.Println("restore: resumed from snapshot taken at", payload.SavedAt)
+	return nil
+}
+
+// ListenForShutdown registers a SIGTERM/SIGINT handler that calls
+// h.Shutdown with deadline and then exits the process. It should be
+// started once from main after the hub is otherwise up and running.
+func ListenForShutdown(h *Hub, deadline time.Duration) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+
+	go func() {
+		sig := <-signals
+		fmt.Println("received", sig, "- shutting down")
+
+		ctx, cancel := context.WithTimeout(context.Background(), deadline)
+		defer cancel()
+
+		if err := h.Shutdown(ctx); err != nil {
+			fmt.Println("shutdown error:", err)
+		}
+		os.Exit(0)
+	}()
+}
@@ -0,0 +1,91 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	ejson "encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// snapshotPayload is the serialized form of everything Hub.Shutdown needs
+// to restore on the next boot: live world state plus leaderboard
+// standings. World and Terrain are left as raw JSON since their shape
+// belongs to those subsystems, not to the snapshot format itself.
+type snapshotPayload struct {
+	SavedAt     time.Time       `json:"saved_at"`
+	World       ejson.RawMessage `json:"world,omitempty"`
+	Terrain     ejson.RawMessage `json:"terrain,omitempty"`
+	Leaderboard []playerRecord  `json:"leaderboard"`
+}
+
+// snapshotFileName returns the name a snapshot taken at t should be
+// written under, so LoadLatestSnapshot can find the newest one by sorting
+// names lexically.
+func snapshotFileName(t time.Time) string {
+	return fmt.Sprintf("mk48-snapshot-%s.json", t.UTC().Format("20060102T150405Z"))
+}
+
+// writeSnapshot serializes payload and writes it to dir, returning the
+// path written. It is written to a temp file and renamed into place so a
+// crash mid-write never leaves a half-written snapshot to load.
+func writeSnapshot(dir string, payload snapshotPayload) (string, error) {
+	data, err := ejson.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("write snapshot: marshal: %w", err)
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("write snapshot: mkdir: %w", err)
+	}
+
+	final := filepath.Join(dir, snapshotFileName(payload.SavedAt))
+	tmp := final + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return "", fmt.Errorf("write snapshot: %w", err)
+	}
+	if err := os.Rename(tmp, final); err != nil {
+		return "", fmt.Errorf("write snapshot: rename: %w", err)
+	}
+	return final, nil
+}
+
+// LoadLatestSnapshot reads the most recently written snapshot in dir, if
+// any. It returns (nil, nil) when dir has no snapshots yet, which is the
+// expected case on a server's very first boot.
+func LoadLatestSnapshot(dir string) (*snapshotPayload, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load snapshot: %w", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && filepath.Ext(entry.Name()) == ".json" {
+			names = append(names, entry.Name())
+		}
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+	sort.Strings(names)
+	latest := names[len(names)-1]
+
+	data, err := os.ReadFile(filepath.Join(dir, latest))
+	if err != nil {
+		return nil, fmt.Errorf("load snapshot: read %s: %w", latest, err)
+	}
+
+	var payload snapshotPayload
+	if err := ejson.Unmarshal(data, &payload); err != nil {
+		return nil, fmt.Errorf("load snapshot: parse %s: %w", latest, err)
+	}
+	return &payload, nil
+}
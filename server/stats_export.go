@@ -0,0 +1,63 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"encoding/csv"
+	ejson "encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// ExportStats dumps every record in store to w in format ("json" or
+// "csv"), for operators who want to run offline analysis outside the
+// live server. Intended to be wired up as a one-off CLI command, e.g.
+// `mk48-server -export-stats=csv > stats.csv`.
+func ExportStats(store StatsStore, w io.Writer, format string) error {
+	entries, err := store.TopN("highest_score", 1<<31-1)
+	if err != nil {
+		return fmt.Errorf("export stats: %w", err)
+	}
+
+	switch format {
+	case "json":
+		return exportStatsJSON(entries, w)
+	case "csv":
+		return exportStatsCSV(entries, w)
+	default:
+		return fmt.Errorf("export stats: unknown format %q (want json or csv)", format)
+	}
+}
+
+func exportStatsJSON(entries []PlayerStatsEntry, w io.Writer) error {
+	encoder := ejson.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(entries)
+}
+
+func exportStatsCSV(entries []PlayerStatsEntry, w io.Writer) error {
+	writer := csv.NewWriter(w)
+	defer writer.Flush()
+
+	header := []string{"player_id", "kills", "deaths", "highest_score", "playtime_secs", "achievements"}
+	if err := writer.Write(header); err != nil {
+		return fmt.Errorf("export stats: %w", err)
+	}
+
+	for _, entry := range entries {
+		row := []string{
+			entry.PlayerID,
+			strconv.Itoa(entry.Stats.Kills),
+			strconv.Itoa(entry.Stats.Deaths),
+			strconv.Itoa(entry.Stats.HighestScore),
+			strconv.Itoa(entry.Stats.PlaytimeSecs),
+			fmt.Sprint(entry.Stats.Achievements),
+		}
+		if err := writer.Write(row); err != nil {
+			return fmt.Errorf("export stats: %w", err)
+		}
+	}
+	return writer.Error()
+}
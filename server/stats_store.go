@@ -0,0 +1,201 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	ejson "encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// PlayerStats is a player's lifetime record, persisted alongside the
+// ephemeral in-memory player.Score used by Hub.Cloud() for the current
+// session's leaderboards.
+type PlayerStats struct {
+	Name         string         `json:"name"` // most recently observed display name
+	Kills        int            `json:"kills"`
+	Deaths       int            `json:"deaths"`
+	HighestScore int            `json:"highest_score"`
+	PlaytimeSecs int            `json:"playtime_secs"`
+	ShipUsage    map[string]int `json:"ship_usage"`
+	Achievements []string       `json:"achievements"`
+}
+
+// PlayerStatsDelta is what a single update contributes to PlayerStats:
+// Name replaces the stored display name (players can rename between
+// sessions), counters add, HighestScore takes the max, ShipUsage adds per
+// key, and Achievements are merged in without duplicates.
+type PlayerStatsDelta struct {
+	Name         string
+	Kills        int
+	Deaths       int
+	Score        int // compared against HighestScore, not added
+	PlaytimeSecs int
+	ShipType     string // incremented in ShipUsage if non-empty
+	Achievement  string // appended to Achievements if non-empty and new
+}
+
+// PlayerStatsEntry pairs a player's identity with their PlayerStats, as
+// returned by StatsStore.TopN.
+type PlayerStatsEntry struct {
+	PlayerID string
+	Stats    PlayerStats
+}
+
+// StatsStore persists per-player lifetime stats. The embedded
+// boltStatsStore is the only implementation today; the interface exists
+// so Hub doesn't need to know which embedded KV engine backs it.
+type StatsStore interface {
+	Get(playerID string) (PlayerStats, error)
+	Merge(playerID string, delta PlayerStatsDelta) error
+	TopN(field string, n int) ([]PlayerStatsEntry, error)
+	Close() error
+}
+
+var statsBucket = []byte("stats")
+
+// boltStatsStore implements StatsStore on top of a single bbolt file.
+type boltStatsStore struct {
+	db *bbolt.DB
+}
+
+// OpenStatsStore opens (creating if necessary) the bbolt database at path.
+func OpenStatsStore(path string) (*boltStatsStore, error) {
+	db, err := bbolt.Open(path, 0o644, &bbolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("open stats store: %w", err)
+	}
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(statsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("open stats store: %w", err)
+	}
+
+	return &boltStatsStore{db: db}, nil
+}
+
+func (s *boltStatsStore) Get(playerID string) (PlayerStats, error) {
+	var stats PlayerStats
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		data := tx.Bucket(statsBucket).Get([]byte(playerID))
+		if data == nil {
+			return nil
+		}
+		return ejson.Unmarshal(data, &stats)
+	})
+	if err != nil {
+		return PlayerStats{}, fmt.Errorf("get stats: %w", err)
+	}
+	return stats, nil
+}
+
+// Merge folds delta into playerID's stored PlayerStats, creating a fresh
+// record if this is the first time playerID has been seen.
+func (s *boltStatsStore) Merge(playerID string, delta PlayerStatsDelta) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(statsBucket)
+
+		var stats PlayerStats
+		if data := bucket.Get([]byte(playerID)); data != nil {
+			if err := ejson.Unmarshal(data, &stats); err != nil {
+				return fmt.Errorf("merge stats: decode existing: %w", err)
+			}
+		}
+		if stats.ShipUsage == nil {
+			stats.ShipUsage = make(map[string]int)
+		}
+		if delta.Name != "" {
+			stats.Name = delta.Name
+		}
+
+		stats.Kills += delta.Kills
+		stats.Deaths += delta.Deaths
+		stats.PlaytimeSecs += delta.PlaytimeSecs
+		if delta.Score > stats.HighestScore {
+			stats.HighestScore = delta.Score
+		}
+		if delta.ShipType != "" {
+			stats.ShipUsage[delta.ShipType]++
+		}
+		if delta.Achievement != "" && !containsString(stats.Achievements, delta.Achievement) {
+			stats.Achievements = append(stats.Achievements, delta.Achievement)
+		}
+
+		data, err := ejson.Marshal(stats)
+		if err != nil {
+			return fmt.Errorf("merge stats: encode: %w", err)
+		}
+		return bucket.Put([]byte(playerID), data)
+	})
+}
+
+func containsString(haystack []string, needle string) bool {
+	for _, s := range haystack {
+		if s == needle {
+			return true
+		}
+	}
+	return false
+}
+
+// TopN scans every stored record and returns the n with the highest value
+// for field ("kills", "deaths", "highest_score", or "playtime_secs").
+// bbolt has no secondary indexes, so this is a linear scan; it's only
+// called from Hub.Cloud()'s periodic lifetime-leaderboard push and from
+// ExportStats, not the hot path.
+func (s *boltStatsStore) TopN(field string, n int) ([]PlayerStatsEntry, error) {
+	fieldValue, err := statsFieldAccessor(field)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []PlayerStatsEntry
+	err = s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(statsBucket).ForEach(func(k, v []byte) error {
+			var stats PlayerStats
+			if err := ejson.Unmarshal(v, &stats); err != nil {
+				return fmt.Errorf("topn: decode %s: %w", k, err)
+			}
+			entries = append(entries, PlayerStatsEntry{PlayerID: string(k), Stats: stats})
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("topn: %w", err)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return fieldValue(entries[i].Stats) > fieldValue(entries[j].Stats)
+	})
+	if len(entries) > n {
+		entries = entries[:n]
+	}
+	return entries, nil
+}
+
+func statsFieldAccessor(field string) (func(PlayerStats) int, error) {
+	switch field {
+	case "kills":
+		return func(s PlayerStats) int { return s.Kills }, nil
+	case "deaths":
+		return func(s PlayerStats) int { return s.Deaths }, nil
+	case "highest_score":
+		return func(s PlayerStats) int { return s.HighestScore }, nil
+	case "playtime_secs":
+		return func(s PlayerStats) int { return s.PlaytimeSecs }, nil
+	default:
+		return nil, fmt.Errorf("topn: unknown field %q", field)
+	}
+}
+
+func (s *boltStatsStore) Close() error {
+	return s.db.Close()
+}